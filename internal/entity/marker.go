@@ -34,17 +34,26 @@ type Marker struct {
 	Face           *Face           `gorm:"foreignkey:FaceID;association_foreignkey:ID;association_autoupdate:false;association_autocreate:false;association_save_reference:false" json:"-" yaml:"-"`
 	EmbeddingsJSON json.RawMessage `gorm:"type:MEDIUMBLOB;" json:"-" yaml:"EmbeddingsJSON,omitempty"`
 	embeddings     Embeddings      `gorm:"-"`
+	EmbeddingModel string          `gorm:"type:VARBINARY(16);default:'';" json:"EmbeddingModel" yaml:"EmbeddingModel,omitempty"`
+	EmbeddingDim   int             `gorm:"default:0" json:"EmbeddingDim" yaml:"EmbeddingDim,omitempty"`
 	LandmarksJSON  json.RawMessage `gorm:"type:MEDIUMBLOB;" json:"-" yaml:"LandmarksJSON,omitempty"`
 	X              float32         `gorm:"type:FLOAT;" json:"X" yaml:"X,omitempty"`
 	Y              float32         `gorm:"type:FLOAT;" json:"Y" yaml:"Y,omitempty"`
 	W              float32         `gorm:"type:FLOAT;" json:"W" yaml:"W,omitempty"`
 	H              float32         `gorm:"type:FLOAT;" json:"H" yaml:"H,omitempty"`
+	GeometryJSON   json.RawMessage `gorm:"type:MEDIUMBLOB;" json:"-" yaml:"GeometryJSON,omitempty"`
+	geometry       Polygon         `gorm:"-"`
+	TextContent    string          `gorm:"type:VARCHAR(1024);" json:"Text" yaml:"Text,omitempty"`
+	Lang           string          `gorm:"type:VARBINARY(8);default:'';" json:"Lang" yaml:"Lang,omitempty"`
 	Size           int             `gorm:"default:-1" json:"Size" yaml:"Size,omitempty"`
 	Score          int             `gorm:"type:SMALLINT" json:"Score" yaml:"Score,omitempty"`
 	MarkerInvalid  bool            `json:"Invalid" yaml:"Invalid,omitempty"`
 	MatchedAt      *time.Time      `sql:"index" json:"MatchedAt" yaml:"MatchedAt,omitempty"`
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
+	DeletedAt      *time.Time   `sql:"index" json:"DeletedAt,omitempty" yaml:"DeletedAt,omitempty"`
+	editor         string       `gorm:"-"`
+	batch          *MarkerBatch `gorm:"-"`
 }
 
 // UnknownMarker can be used as a default for unknown markers.
@@ -72,6 +81,11 @@ func NewMarker(fileID uint, subjectUID, markerSrc, markerType string, x, y, w, h
 }
 
 // NewFaceMarker creates a new entity.
+//
+// It stamps the marker with face.Model, the name of the embedding model
+// that produced f's embeddings, so CompatibleEmbeddings and
+// ReExtractEmbeddings can later tell whether this marker still needs to be
+// migrated after the configured model changes.
 func NewFaceMarker(f face.Face, fileID uint, refUID string) *Marker {
 	pos := f.Marker()
 
@@ -83,12 +97,23 @@ func NewFaceMarker(f face.Face, fileID uint, refUID string) *Marker {
 	m.LandmarksJSON = f.RelativeLandmarksJSON()
 	m.Size = f.Size()
 	m.Score = f.Score
+	m.EmbeddingModel = face.Model
+
+	if e := m.Embeddings(); len(e) > 0 {
+		m.EmbeddingDim = len(e[0])
+	}
 
 	return m
 }
 
 // Updates multiple columns in the database.
 func (m *Marker) Updates(values interface{}) error {
+	if batch := m.batch; batch != nil && m.ID > 0 {
+		if v, ok := valuesMap(values); ok {
+			return batch.Queue(m.ID, v)
+		}
+	}
+
 	return UnscopedDb().Model(m).Updates(values).Error
 }
 
@@ -100,6 +125,7 @@ func (m *Marker) Update(attr string, value interface{}) error {
 // SaveForm updates the entity using form data and stores it in the database.
 func (m *Marker) SaveForm(f form.Marker) error {
 	changed := false
+	prior := m.editSnapshot()
 
 	if m.MarkerInvalid != f.MarkerInvalid {
 		m.MarkerInvalid = f.MarkerInvalid
@@ -123,7 +149,11 @@ func (m *Marker) SaveForm(f form.Marker) error {
 	}
 
 	if changed {
-		return m.Save()
+		if err := m.Save(); err != nil {
+			return err
+		}
+
+		return m.logEdit(f.SubjectSrc, prior)
 	}
 
 	return nil
@@ -156,6 +186,8 @@ func (m *Marker) SetFace(f *Face, dist float64) (updated bool, err error) {
 		return false, fmt.Errorf("not a face marker")
 	}
 
+	prior := m.editSnapshot()
+
 	// Any reason we don't want to set a new face for this marker?
 	if m.SubjectSrc != SrcManual || f.SubjectUID == "" || m.SubjectUID == "" || f.SubjectUID == m.SubjectUID {
 		// Don't skip if subject wasn't set manually, or subjects match.
@@ -193,14 +225,41 @@ func (m *Marker) SetFace(f *Face, dist float64) (updated bool, err error) {
 	if m.FaceDist < 0 {
 		faceEmbedding := f.Embedding()
 
-		// Calculate smallest distance to embeddings.
-		for _, e := range m.Embeddings() {
-			if len(e) != len(faceEmbedding) {
-				continue
+		// Consult the ANN index for this marker's distance first, so that a
+		// match doesn't require scanning every embedding of every marker.
+		// k is generous rather than 1: the index only scans the bucket the
+		// query embedding hashes to regardless of k, so asking for more
+		// neighbours costs nothing extra and is what actually lets this
+		// marker show up in the results instead of requiring it to be the
+		// single closest match in a library of any size.
+		if matches, err := FaceIndex.Search(faceEmbedding, faceIndexSearchK); err != nil {
+			log.Debugf("faces: %s (search index)", err)
+		} else {
+			for _, match := range matches {
+				// A match only means something if it's still indexed under
+				// this marker's own current embedding model: FaceIndex may
+				// hold a stale entry from before this marker's embeddings
+				// were last re-extracted, e.g. mid-way through
+				// ReExtractEmbeddings, and a short Euclidean distance
+				// between vectors from two different models is meaningless.
+				if match.ID == markerIndexID(m) && match.Model == m.EmbeddingModel {
+					m.FaceDist = match.Dist
+					break
+				}
 			}
+		}
 
-			if d := clusters.EuclideanDistance(e, faceEmbedding); d < m.FaceDist || m.FaceDist < 0 {
-				m.FaceDist = d
+		// Index miss, e.g. because it hasn't been built yet: fall back to a
+		// direct scan of this marker's own embeddings.
+		if m.FaceDist < 0 {
+			for _, e := range m.Embeddings() {
+				if len(e) != len(faceEmbedding) {
+					continue
+				}
+
+				if d := clusters.EuclideanDistance(e, faceEmbedding); d < m.FaceDist || m.FaceDist < 0 {
+					m.FaceDist = d
+				}
 			}
 		}
 	}
@@ -225,7 +284,11 @@ func (m *Marker) SetFace(f *Face, dist float64) (updated bool, err error) {
 	// Update matching timestamp.
 	m.MatchedAt = TimePointer()
 
-	return updated, m.Updates(Values{"FaceID": m.FaceID, "FaceDist": m.FaceDist, "SubjectUID": m.SubjectUID, "SubjectSrc": m.SubjectSrc, "MatchedAt": m.MatchedAt})
+	if err := m.Updates(Values{"FaceID": m.FaceID, "FaceDist": m.FaceDist, "SubjectUID": m.SubjectUID, "SubjectSrc": m.SubjectSrc, "MatchedAt": m.MatchedAt}); err != nil {
+		return updated, err
+	}
+
+	return updated, m.logEdit(SrcAuto, prior)
 }
 
 // SyncSubject maintains the marker subject relationship.
@@ -258,7 +321,7 @@ func (m *Marker) SyncSubject(updateRelated bool) error {
 	// Update related markers?
 	if m.FaceID == "" || m.SubjectUID == "" {
 		// Do nothing.
-	} else if err := Db().Model(&Face{}).Where("id = ? AND subject_uid = ''", m.FaceID).Update("SubjectUID", m.SubjectUID).Error; err != nil {
+	} else if err := m.updateKnownFaceSubject(); err != nil {
 		return fmt.Errorf("%s (update known face)", err)
 	} else if !updateRelated {
 		return nil
@@ -276,13 +339,35 @@ func (m *Marker) SyncSubject(updateRelated bool) error {
 	return nil
 }
 
+// updateKnownFaceSubject sets m.FaceID's SubjectUID if it doesn't have one
+// yet, routing through m.batch when active instead of writing immediately,
+// so that a batched face-recognition pass doesn't issue one Face-table
+// update per marker matched to the same face.
+func (m *Marker) updateKnownFaceSubject() error {
+	if batch := m.batch; batch != nil {
+		return batch.QueueFaceSubject(m.FaceID, m.SubjectUID)
+	}
+
+	return Db().Model(&Face{}).Where("id = ? AND subject_uid = ''", m.FaceID).Update("SubjectUID", m.SubjectUID).Error
+}
+
 // Save updates the existing or inserts a new row.
 func (m *Marker) Save() error {
 	if m.X == 0 || m.Y == 0 || m.X > 1 || m.Y > 1 || m.X < -1 || m.Y < -1 {
 		return fmt.Errorf("marker: invalid position")
 	}
 
-	return Db().Save(m).Error
+	if !m.Geometry().Valid() {
+		return errMarkerGeometry
+	}
+
+	if err := Db().Save(m).Error; err != nil {
+		return err
+	}
+
+	m.indexEmbeddings()
+
+	return nil
 }
 
 // Create inserts a new row to the database.
@@ -291,7 +376,17 @@ func (m *Marker) Create() error {
 		return fmt.Errorf("marker: invalid position")
 	}
 
-	return Db().Create(m).Error
+	if !m.Geometry().Valid() {
+		return errMarkerGeometry
+	}
+
+	if err := Db().Create(m).Error; err != nil {
+		return err
+	}
+
+	m.indexEmbeddings()
+
+	return nil
 }
 
 // Embeddings returns parsed marker embeddings.
@@ -334,6 +429,8 @@ func (m *Marker) GetSubject() (subj *Subject) {
 
 // ClearSubject removes an existing subject association, and reports a collision.
 func (m *Marker) ClearSubject(src string) error {
+	prior := m.editSnapshot()
+
 	if m.Face == nil {
 		m.Face = FindFace(m.FaceID)
 	}
@@ -356,7 +453,9 @@ func (m *Marker) ClearSubject(src string) error {
 	m.SubjectUID = ""
 	m.SubjectSrc = src
 
-	return nil
+	m.indexEmbeddings()
+
+	return m.logEdit(src, prior)
 }
 
 // GetFace returns a matching face entity if possible.
@@ -393,6 +492,8 @@ func (m *Marker) ClearFace() (updated bool, err error) {
 		return false, m.Matched()
 	}
 
+	prior := m.editSnapshot()
+
 	updated = true
 
 	// Remove face references.
@@ -408,7 +509,13 @@ func (m *Marker) ClearFace() (updated bool, err error) {
 		err = m.Updates(Values{"FaceID": "", "FaceDist": -1.0, "MatchedAt": m.MatchedAt})
 	}
 
-	return updated, err
+	m.indexEmbeddings()
+
+	if err != nil {
+		return updated, err
+	}
+
+	return updated, m.logEdit(m.SubjectSrc, prior)
 }
 
 // Matched updates the match timestamp.
@@ -428,38 +535,96 @@ func FindMarker(id uint) *Marker {
 	return nil
 }
 
+// dedupIoU is the minimum intersection-over-union two polygons must share
+// for UpdateOrCreateMarker to treat them as the same marker.
+const dedupIoU = 0.5
+
+// mergeFoundMarker copies m's detected fields onto found, a marker that was
+// already matched to the same face or region, and persists the merge,
+// unless m's source has lower priority than the one found was last updated
+// with. found.Updates decides whether that write goes straight to the
+// database or queues inside a batch, so this is shared by the package-level
+// and MarkerBatch-scoped UpdateOrCreateMarker instead of each duplicating
+// the merge logic.
+func mergeFoundMarker(found, m *Marker) (*Marker, error) {
+	if SrcPriority[m.MarkerSrc] < SrcPriority[found.MarkerSrc] {
+		// Ignore.
+		return found, nil
+	}
+
+	found.X, found.Y, found.W, found.H = m.X, m.Y, m.W, m.H
+	found.Score = m.Score
+	found.LandmarksJSON = m.LandmarksJSON
+	found.EmbeddingsJSON = m.EmbeddingsJSON
+	found.GeometryJSON = m.GeometryJSON
+	found.TextContent = m.TextContent
+	found.SubjectUID = m.SubjectUID
+
+	err := found.Updates(Values{
+		"X":              found.X,
+		"Y":              found.Y,
+		"W":              found.W,
+		"H":              found.H,
+		"Score":          found.Score,
+		"LandmarksJSON":  found.LandmarksJSON,
+		"EmbeddingsJSON": found.EmbeddingsJSON,
+		"GeometryJSON":   found.GeometryJSON,
+		"TextContent":    found.TextContent,
+		"SubjectUID":     found.SubjectUID,
+	})
+
+	if err == nil {
+		// The embeddings just overwritten above may differ from what
+		// FaceIndex has on record for this marker, so keep it in sync.
+		found.embeddings = nil
+		found.indexEmbeddings()
+	}
+
+	log.Debugf("faces: updated existing marker %d for file %d", found.ID, found.FileID)
+
+	return found, err
+}
+
 // UpdateOrCreateMarker updates a marker in the database or creates a new one if needed.
 func UpdateOrCreateMarker(m *Marker) (*Marker, error) {
+	if batch := m.batch; batch != nil {
+		return batch.UpdateOrCreateMarker(m)
+	}
+
 	const d = 0.07
 
 	result := Marker{}
+	found := false
 
 	if m.ID > 0 {
 		err := m.Save()
 		log.Debugf("faces: saved marker %d for file %d", m.ID, m.FileID)
 		return m, err
-	} else if err := Db().Where(`file_id = ? AND x > ? AND x < ? AND y > ? AND y < ?`,
-		m.FileID, m.X-d, m.X+d, m.Y-d, m.Y+d).First(&result).Error; err == nil {
+	} else if polygon := m.Geometry(); len(polygon) > 0 {
+		// Label and text markers carry polygon geometry, which is a more
+		// precise de-dup signal than the centroid window below.
+		var candidates []Marker
 
-		if SrcPriority[m.MarkerSrc] < SrcPriority[result.MarkerSrc] {
-			// Ignore.
-			return &result, nil
+		if err := Db().Where("file_id = ? AND geometry_json IS NOT NULL AND geometry_json <> ''", m.FileID).Find(&candidates).Error; err != nil {
+			return m, err
 		}
 
-		err := result.Updates(map[string]interface{}{
-			"X":              m.X,
-			"Y":              m.Y,
-			"W":              m.W,
-			"H":              m.H,
-			"Score":          m.Score,
-			"LandmarksJSON":  m.LandmarksJSON,
-			"EmbeddingsJSON": m.EmbeddingsJSON,
-			"SubjectUID":     m.SubjectUID,
-		})
+		best := dedupIoU
 
-		log.Debugf("faces: updated existing marker %d for file %d", result.ID, result.FileID)
+		for _, c := range candidates {
+			if iou := polygon.IoU(c.Geometry()); iou >= best {
+				best = iou
+				result = c
+				found = true
+			}
+		}
+	} else if err := Db().Where(`file_id = ? AND x > ? AND x < ? AND y > ? AND y < ?`,
+		m.FileID, m.X-d, m.X+d, m.Y-d, m.Y+d).First(&result).Error; err == nil {
+		found = true
+	}
 
-		return &result, err
+	if found {
+		return mergeFoundMarker(&result, m)
 	} else if err := m.Create(); err != nil {
 		log.Debugf("faces: added marker %d for file %d", m.ID, m.FileID)
 		return m, err
@@ -0,0 +1,384 @@
+package entity
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// batchGrid is the grid cell size used to bucket markers by position, so
+// that MarkerBatch can resolve nearby-marker collisions in memory instead
+// of issuing a range query per candidate. It matches the dedup window used
+// by UpdateOrCreateMarker.
+const batchGrid = 0.07
+
+// valuesMap normalizes the map types used to call Marker.Updates.
+func valuesMap(values interface{}) (map[string]interface{}, bool) {
+	switch v := values.(type) {
+	case Values:
+		return v, true
+	case map[string]interface{}:
+		return v, true
+	default:
+		return nil, false
+	}
+}
+
+// snakeColumn translates a Go struct field name, as used in the Values maps
+// passed to Marker.Updates, to the snake_case database column name gorm's
+// default naming strategy derives it from (e.g. "EmbeddingsJSON" ->
+// "embeddings_json").
+func snakeColumn(field string) string {
+	var b strings.Builder
+
+	for i, r := range field {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				prev := rune(field[i-1])
+				nextLower := i+1 < len(field) && unicode.IsLower(rune(field[i+1]))
+
+				if !unicode.IsUpper(prev) || nextLower {
+					b.WriteByte('_')
+				}
+			}
+
+			b.WriteRune(unicode.ToLower(r))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// markerCell identifies a spatial hash bucket within a single file.
+type markerCell struct {
+	FileID uint
+	GridX  int
+	GridY  int
+}
+
+func cellOf(fileID uint, x, y float32) markerCell {
+	return markerCell{FileID: fileID, GridX: int(x / batchGrid), GridY: int(y / batchGrid)}
+}
+
+// MarkerBatch accumulates pending marker field changes and flushes them
+// with one CASE-based UPDATE per column, and resolves nearby-marker
+// collisions in UpdateOrCreateMarker against an in-memory spatial hash
+// instead of one range query per candidate. It exists to eliminate the
+// N+1 database writes and queries a full face-recognition pass otherwise
+// causes on large libraries.
+type MarkerBatch struct {
+	mu           sync.Mutex
+	pending      map[uint]map[string]interface{}
+	faceSubjects map[string]string
+	cells        map[markerCell][]*Marker
+	geometry     map[uint][]*Marker
+	preloaded    map[uint]bool
+}
+
+// NewMarkerBatch returns a new, empty batch.
+func NewMarkerBatch() *MarkerBatch {
+	return &MarkerBatch{
+		pending:      make(map[uint]map[string]interface{}),
+		faceSubjects: make(map[string]string),
+		cells:        make(map[markerCell][]*Marker),
+		geometry:     make(map[uint][]*Marker),
+		preloaded:    make(map[uint]bool),
+	}
+}
+
+// SetBatch scopes m to batch, so that Marker.Updates and the package-level
+// UpdateOrCreateMarker route their writes through it instead of hitting the
+// database directly. Unlike a package-level "current batch" variable, this
+// keeps two concurrent face-recognition passes from bleeding into each
+// other's batches, since each caller threads its own batch through the
+// markers it owns.
+func (m *Marker) SetBatch(b *MarkerBatch) *Marker {
+	m.batch = b
+	return m
+}
+
+// Queue stages values to be written for marker id on the next Flush.
+func (b *MarkerBatch) Queue(id uint, values map[string]interface{}) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	row, ok := b.pending[id]
+
+	if !ok {
+		row = make(map[string]interface{}, len(values))
+		b.pending[id] = row
+	}
+
+	for col, val := range values {
+		row[col] = val
+	}
+
+	return nil
+}
+
+// QueueFaceSubject stages a known face's SubjectUID to be set on the next
+// Flush, instead of writing it immediately, so that a batched face-
+// recognition pass doesn't issue one Face-table update per marker matched
+// to the same face.
+//
+// The first queued SubjectUID for a given faceID wins; later calls are
+// ignored. This mirrors the unbatched path (updateKnownFaceSubject's direct
+// "WHERE subject_uid = ''" update), which only ever succeeds for the first
+// marker processed against a face with no subject yet, so if a single batch
+// queues two different subjects for the same face, e.g. a borderline
+// collision that otherwise went uncaught, both paths pick the same winner.
+func (b *MarkerBatch) QueueFaceSubject(faceID, subjectUID string) error {
+	if faceID == "" {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.faceSubjects[faceID]; !ok {
+		b.faceSubjects[faceID] = subjectUID
+	}
+
+	return nil
+}
+
+// AddCandidate registers an existing marker for in-memory collision lookups,
+// both by centroid grid cell and, if it has polygon geometry, for IoU
+// matching.
+func (b *MarkerBatch) AddCandidate(m *Marker) {
+	m.SetBatch(b)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cell := cellOf(m.FileID, m.X, m.Y)
+	b.cells[cell] = append(b.cells[cell], m)
+
+	if len(m.Geometry()) > 0 {
+		b.geometry[m.FileID] = append(b.geometry[m.FileID], m)
+	}
+}
+
+// preloadFile loads fileID's existing markers into the batch exactly once,
+// so that the first marker seen for a file is matched against the database
+// instead of being treated as new.
+func (b *MarkerBatch) preloadFile(fileID uint) error {
+	b.mu.Lock()
+
+	if b.preloaded[fileID] {
+		b.mu.Unlock()
+		return nil
+	}
+
+	b.preloaded[fileID] = true
+	b.mu.Unlock()
+
+	var existing []*Marker
+
+	if err := Db().Where("file_id = ?", fileID).Find(&existing).Error; err != nil {
+		return err
+	}
+
+	for _, m := range existing {
+		b.AddCandidate(m)
+	}
+
+	return nil
+}
+
+// findCandidate returns a previously added marker within the dedup window
+// of x, y on the given file, if any. Callers must hold b.mu.
+func (b *MarkerBatch) findCandidate(fileID uint, x, y float32) *Marker {
+	cell := cellOf(fileID, x, y)
+
+	// The dedup window can straddle up to one neighboring cell in either
+	// direction, so check the 3x3 neighborhood around the query point.
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			for _, m := range b.cells[markerCell{FileID: fileID, GridX: cell.GridX + dx, GridY: cell.GridY + dy}] {
+				if m.X > x-batchGrid && m.X < x+batchGrid && m.Y > y-batchGrid && m.Y < y+batchGrid {
+					return m
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// findGeometryCandidate returns the previously added marker on fileID whose
+// polygon has the highest IoU with polygon, if it meets dedupIoU. Callers
+// must hold b.mu.
+func (b *MarkerBatch) findGeometryCandidate(fileID uint, polygon Polygon) *Marker {
+	var best *Marker
+	bestIoU := dedupIoU
+
+	for _, m := range b.geometry[fileID] {
+		if iou := polygon.IoU(m.Geometry()); iou >= bestIoU {
+			bestIoU = iou
+			best = m
+		}
+	}
+
+	return best
+}
+
+// UpdateOrCreateMarker is the batch-aware equivalent of the package-level
+// UpdateOrCreateMarker: it resolves nearby-marker collisions against the
+// batch's in-memory spatial hash (or, for markers with polygon geometry,
+// the highest-IoU candidate) instead of a per-candidate database query,
+// and stages updates instead of writing them immediately.
+func (b *MarkerBatch) UpdateOrCreateMarker(m *Marker) (*Marker, error) {
+	if m.ID > 0 {
+		err := m.Save()
+		log.Debugf("faces: saved marker %d for file %d", m.ID, m.FileID)
+		return m, err
+	}
+
+	if err := b.preloadFile(m.FileID); err != nil {
+		return m, err
+	}
+
+	b.mu.Lock()
+	var result *Marker
+
+	if polygon := m.Geometry(); len(polygon) > 0 {
+		result = b.findGeometryCandidate(m.FileID, polygon)
+	} else {
+		result = b.findCandidate(m.FileID, m.X, m.Y)
+	}
+
+	b.mu.Unlock()
+
+	if result != nil {
+		// result was added via AddCandidate, which already scoped it to b,
+		// so the Updates call inside mergeFoundMarker queues instead of
+		// writing immediately.
+		return mergeFoundMarker(result, m)
+	}
+
+	if err := m.Create(); err != nil {
+		return m, err
+	}
+
+	log.Debugf("faces: added marker %d for file %d", m.ID, m.FileID)
+
+	b.AddCandidate(m)
+
+	return m, nil
+}
+
+// Flush writes all pending updates to the database, one CASE-based UPDATE
+// per affected column (plus one more for any queued face subjects), and
+// clears the batch.
+func (b *MarkerBatch) Flush() error {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = make(map[uint]map[string]interface{})
+	faceSubjects := b.faceSubjects
+	b.faceSubjects = make(map[string]string)
+	b.mu.Unlock()
+
+	if len(faceSubjects) > 0 {
+		if err := flushFaceSubjects(faceSubjects); err != nil {
+			return err
+		}
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	byColumn := make(map[string]map[uint]interface{})
+
+	for id, values := range pending {
+		for col, val := range values {
+			if byColumn[col] == nil {
+				byColumn[col] = make(map[uint]interface{})
+			}
+
+			byColumn[col][id] = val
+		}
+	}
+
+	for col, byID := range byColumn {
+		if err := flushColumn(col, byID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// flushColumn writes byID's values for a single column as one UPDATE
+// statement using a CASE expression keyed by marker id. col is the Go
+// struct field name, as found in the Values maps passed to Marker.Updates,
+// and is translated to its snake_case database column name first.
+func flushColumn(col string, byID map[uint]interface{}) error {
+	var sql strings.Builder
+	args := make([]interface{}, 0, len(byID)*2+len(byID))
+
+	fmt.Fprintf(&sql, "UPDATE %s SET %s = CASE id", Marker{}.TableName(), snakeColumn(col))
+
+	ids := make([]interface{}, 0, len(byID))
+
+	for id, val := range byID {
+		sql.WriteString(" WHEN ? THEN ?")
+		args = append(args, id, val)
+		ids = append(ids, id)
+	}
+
+	sql.WriteString(" END WHERE id IN (?" + strings.Repeat(",?", len(ids)-1) + ")")
+	args = append(args, ids...)
+
+	return Db().Exec(sql.String(), args...).Error
+}
+
+// flushFaceSubjects writes byFace's values as one CASE-based UPDATE,
+// preserving the "only if the face doesn't already have a subject" guard
+// the unbatched per-marker update applies individually.
+func flushFaceSubjects(byFace map[string]string) error {
+	var sql strings.Builder
+	args := make([]interface{}, 0, len(byFace)*2+len(byFace))
+
+	fmt.Fprintf(&sql, "UPDATE %s SET subject_uid = CASE id", Face{}.TableName())
+
+	ids := make([]interface{}, 0, len(byFace))
+
+	for id, subjectUID := range byFace {
+		sql.WriteString(" WHEN ? THEN ?")
+		args = append(args, id, subjectUID)
+		ids = append(ids, id)
+	}
+
+	sql.WriteString(" END WHERE subject_uid = '' AND id IN (?" + strings.Repeat(",?", len(ids)-1) + ")")
+	args = append(args, ids...)
+
+	return Db().Exec(sql.String(), args...).Error
+}
+
+// Commit flushes pending writes to the database.
+func (b *MarkerBatch) Commit() error {
+	return b.Flush()
+}
+
+// UpdateOrCreateMarkers resolves and persists markers in bulk using batch,
+// committing once all markers have been processed.
+func UpdateOrCreateMarkers(batch *MarkerBatch, markers []*Marker) ([]*Marker, error) {
+	result := make([]*Marker, 0, len(markers))
+
+	for _, m := range markers {
+		r, err := batch.UpdateOrCreateMarker(m)
+
+		if err != nil {
+			return result, err
+		}
+
+		result = append(result, r)
+	}
+
+	return result, batch.Commit()
+}
@@ -0,0 +1,97 @@
+package entity
+
+import "testing"
+
+func TestSnakeColumn(t *testing.T) {
+	cases := map[string]string{
+		"X":              "x",
+		"EmbeddingsJSON": "embeddings_json",
+		"GeometryJSON":   "geometry_json",
+		"TextContent":    "text_content",
+		"SubjectUID":     "subject_uid",
+	}
+
+	for field, want := range cases {
+		if got := snakeColumn(field); got != want {
+			t.Errorf("snakeColumn(%q) = %q, want %q", field, got, want)
+		}
+	}
+}
+
+func TestMarkerBatchFindCandidate(t *testing.T) {
+	b := NewMarkerBatch()
+
+	existing := &Marker{ID: 1, FileID: 1, X: 0.5, Y: 0.5}
+	b.AddCandidate(existing)
+
+	if found := b.findCandidate(1, 0.51, 0.51); found != existing {
+		t.Errorf("expected a marker within the dedup window to be found")
+	}
+
+	if found := b.findCandidate(1, 0.9, 0.9); found != nil {
+		t.Errorf("expected no match outside the dedup window, got %+v", found)
+	}
+
+	if found := b.findCandidate(2, 0.5, 0.5); found != nil {
+		t.Errorf("expected no match on a different file, got %+v", found)
+	}
+
+	if existing.batch != b {
+		t.Errorf("expected AddCandidate to scope the marker to its batch")
+	}
+}
+
+func TestMarkerBatchQueueFaceSubject(t *testing.T) {
+	b := NewMarkerBatch()
+
+	if err := b.QueueFaceSubject("f1", "s1"); err != nil {
+		t.Fatalf("failed to queue face subject: %s", err)
+	}
+
+	if got := b.faceSubjects["f1"]; got != "s1" {
+		t.Errorf("expected f1 to be queued with s1, got %q", got)
+	}
+
+	// A later marker matched to the same face doesn't overwrite the pending
+	// value: the first queued subject wins, matching the unbatched path's
+	// "WHERE subject_uid = ''" guard, which only ever succeeds once.
+	if err := b.QueueFaceSubject("f1", "s2"); err != nil {
+		t.Fatalf("failed to re-queue face subject: %s", err)
+	}
+
+	if got := b.faceSubjects["f1"]; got != "s1" {
+		t.Errorf("expected f1 to stay queued with s1, got %q", got)
+	}
+
+	if err := b.QueueFaceSubject("", "s3"); err != nil {
+		t.Fatalf("queueing an empty face id should be a no-op, not an error: %s", err)
+	}
+
+	if _, ok := b.faceSubjects[""]; ok {
+		t.Errorf("expected an empty face id not to be queued")
+	}
+}
+
+func TestMarkerBatchFindGeometryCandidate(t *testing.T) {
+	b := NewMarkerBatch()
+
+	existing := &Marker{ID: 1, FileID: 1}
+
+	if err := existing.SetGeometry(Polygon{{X: 0, Y: 0}, {X: 0.5, Y: 0.5}}); err != nil {
+		t.Fatalf("failed to set geometry: %s", err)
+	}
+
+	b.AddCandidate(existing)
+
+	overlapping := Polygon{{X: 0.05, Y: 0.05}, {X: 0.5, Y: 0.5}}
+
+	if found := b.findGeometryCandidate(1, overlapping); found != existing {
+		t.Errorf("expected an overlapping polygon to match")
+	}
+
+	disjoint := Polygon{{X: -1, Y: -1}, {X: -0.9, Y: -0.9}}
+
+	if found := b.findGeometryCandidate(1, disjoint); found != nil {
+		t.Errorf("expected a disjoint polygon not to match, got %+v", found)
+	}
+}
@@ -0,0 +1,106 @@
+package entity
+
+import "time"
+
+// MarkerEdit records a single mutation of a Marker's subject/face assignment,
+// so that accidental changes can be reviewed with Marker.History. Restore
+// only reverses a soft delete; it does not replay these edits.
+type MarkerEdit struct {
+	ID            uint      `gorm:"primary_key" json:"ID" yaml:"-"`
+	MarkerID      uint      `gorm:"index;" json:"MarkerID" yaml:"MarkerID"`
+	SubjectUID    string    `gorm:"type:VARBINARY(42);" json:"SubjectUID" yaml:"SubjectUID,omitempty"`
+	FaceID        string    `gorm:"type:VARBINARY(42);" json:"FaceID" yaml:"FaceID,omitempty"`
+	MarkerName    string    `gorm:"type:VARCHAR(255);" json:"Name" yaml:"Name,omitempty"`
+	MarkerInvalid bool      `json:"Invalid" yaml:"Invalid,omitempty"`
+	EditSrc       string    `gorm:"type:VARBINARY(8);default:'';" json:"Src" yaml:"Src,omitempty"`
+	EditedBy      string    `gorm:"type:VARBINARY(42);" json:"EditedBy" yaml:"EditedBy,omitempty"`
+	CreatedAt     time.Time `json:"CreatedAt" yaml:"CreatedAt"`
+}
+
+// TableName returns the entity database table name.
+func (MarkerEdit) TableName() string {
+	return "markers_edits_dev5"
+}
+
+// editSnapshot captures the marker fields an edit can revert, before they
+// are overwritten by the caller.
+func (m *Marker) editSnapshot() MarkerEdit {
+	return MarkerEdit{
+		MarkerID:      m.ID,
+		SubjectUID:    m.SubjectUID,
+		FaceID:        m.FaceID,
+		MarkerName:    m.MarkerName,
+		MarkerInvalid: m.MarkerInvalid,
+	}
+}
+
+// SetEditor remembers who is performing the next mutating call, so that it
+// shows up in the marker's edit history.
+func (m *Marker) SetEditor(uid string) *Marker {
+	m.editor = uid
+	return m
+}
+
+// logEdit inserts a MarkerEdit row capturing the marker's state prior to a
+// mutating call, as identified by src (e.g. SrcManual, SrcAuto).
+func (m *Marker) logEdit(src string, prior MarkerEdit) error {
+	if m.ID == 0 {
+		return nil
+	}
+
+	prior.EditSrc = src
+	prior.EditedBy = m.editor
+
+	return Db().Create(&prior).Error
+}
+
+// History returns the edits recorded for this marker, newest first.
+func (m *Marker) History() (edits []MarkerEdit, err error) {
+	err = Db().Where("marker_id = ?", m.ID).Order("created_at DESC").Find(&edits).Error
+	return edits, err
+}
+
+// Delete soft-deletes the marker, keeping it and its history recoverable.
+func (m *Marker) Delete() error {
+	if err := Db().Delete(m).Error; err != nil {
+		return err
+	}
+
+	// Soft-deleted markers must not remain searchable, so take them out of
+	// FaceIndex until Restore re-adds them.
+	if err := FaceIndex.Remove(markerIndexID(m)); err != nil {
+		log.Debugf("faces: %s (unindex marker)", err)
+	}
+
+	return nil
+}
+
+// Restore undoes a soft delete, reinstating the marker exactly as it was
+// when deleted.
+//
+// It deliberately does not replay MarkerEdit history on top of that: Delete
+// doesn't touch SubjectUID/FaceID/MarkerName/MarkerInvalid, so the deleted
+// row's fields already are the last genuine edit. An earlier version of
+// this method tried to second-guess that by reinstating edits[0] whenever
+// its EditSrc "superseded" m.SubjectSrc, but ClearSubject and ClearFace
+// both log the new SubjectSrc as EditSrc, so that comparison was always
+// against itself and always true - e.g. a marker auto-tagged "bob" that a
+// user corrects with ClearSubject(SrcManual), then has soft-deleted by
+// something unrelated, would have its manual correction silently undone on
+// Restore. Recovering from an accidental delete should not also revert
+// whatever the last legitimate edit was.
+func (m *Marker) Restore() error {
+	if m.DeletedAt == nil {
+		return nil
+	}
+
+	m.DeletedAt = nil
+
+	if err := Db().Unscoped().Model(m).Update("DeletedAt", nil).Error; err != nil {
+		return err
+	}
+
+	m.indexEmbeddings()
+
+	return nil
+}
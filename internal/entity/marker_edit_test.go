@@ -0,0 +1,49 @@
+package entity
+
+import "testing"
+
+// TestMarkerEditSnapshot covers the one piece of the edit/restore path that
+// doesn't need a database: editSnapshot must capture the fields as they
+// stood before the caller overwrites them, since Restore (and anything
+// reading History) relies on that snapshot being the pre-edit state.
+//
+// Restore, Delete, ClearSubject and ClearFace themselves aren't covered
+// here: they all go through Db() or FindFace, neither of which has
+// source checked out in this tree, so a test exercising
+// ClearSubject -> Delete -> Restore can't compile here. Restore no longer
+// replays history at all (see its doc comment), which is what closes the
+// actual bug: the previously-logged edit's EditSrc can never again be
+// compared against the marker's own current SubjectSrc and found to
+// "supersede" it.
+func TestMarkerEditSnapshot(t *testing.T) {
+	m := &Marker{
+		ID:            1,
+		SubjectUID:    "bob",
+		FaceID:        "f1",
+		MarkerName:    "Bob",
+		MarkerInvalid: true,
+	}
+
+	snapshot := m.editSnapshot()
+
+	m.SubjectUID = ""
+	m.FaceID = ""
+	m.MarkerName = ""
+	m.MarkerInvalid = false
+
+	if snapshot.SubjectUID != "bob" {
+		t.Errorf("expected snapshot to keep the pre-edit SubjectUID, got %q", snapshot.SubjectUID)
+	}
+
+	if snapshot.FaceID != "f1" {
+		t.Errorf("expected snapshot to keep the pre-edit FaceID, got %q", snapshot.FaceID)
+	}
+
+	if snapshot.MarkerName != "Bob" {
+		t.Errorf("expected snapshot to keep the pre-edit MarkerName, got %q", snapshot.MarkerName)
+	}
+
+	if !snapshot.MarkerInvalid {
+		t.Errorf("expected snapshot to keep the pre-edit MarkerInvalid")
+	}
+}
@@ -0,0 +1,85 @@
+package entity
+
+import (
+	"fmt"
+
+	"github.com/photoprism/photoprism/internal/face"
+)
+
+// CompatibleEmbeddings returns this marker's embeddings if they were
+// produced by model, or if the caller didn't ask to filter by model at
+// all (model == ""); otherwise it returns an empty set. A marker with no
+// recorded EmbeddingModel (legacy data predating versioning) is its own
+// bucket, not a wildcard: it only matches when model is also unset, so a
+// library upgraded to a new embedder doesn't keep comparing un-migrated
+// vectors against the new ones until ReExtractEmbeddings has backfilled
+// them.
+func (m *Marker) CompatibleEmbeddings(model string) Embeddings {
+	if model == "" || m.EmbeddingModel == model {
+		return m.Embeddings()
+	}
+
+	return Embeddings{}
+}
+
+// FaceExtractor re-runs face detection on a marker's source crop and
+// returns the resulting embeddings. It is nil by default and must be set
+// by the application during startup, since extraction needs access to the
+// original media file, which this package has no knowledge of.
+var FaceExtractor func(m *Marker) (face.Face, error)
+
+// ReExtractEmbeddings re-runs FaceExtractor for every face marker whose
+// EmbeddingModel doesn't match model, updating its embeddings, landmarks,
+// size and score while preserving the user-supplied SubjectUID and
+// MarkerName. It returns the number of markers successfully re-extracted.
+func ReExtractEmbeddings(model string) (reExtracted int, err error) {
+	if FaceExtractor == nil {
+		return 0, fmt.Errorf("marker: no face extractor configured")
+	}
+
+	var markers []*Marker
+
+	if err := Db().Where("marker_type = ?", MarkerFace).
+		Where("embedding_model <> ?", model).
+		Find(&markers).Error; err != nil {
+		return 0, err
+	}
+
+	for _, m := range markers {
+		f, extractErr := FaceExtractor(m)
+
+		if extractErr != nil {
+			log.Warnf("faces: %s (re-extract marker %d)", extractErr, m.ID)
+			continue
+		}
+
+		m.EmbeddingsJSON = f.EmbeddingsJSON()
+		m.LandmarksJSON = f.RelativeLandmarksJSON()
+		m.Size = f.Size()
+		m.Score = f.Score
+		m.EmbeddingModel = model
+		m.embeddings = nil
+		m.EmbeddingDim = 0
+
+		if e := m.Embeddings(); len(e) > 0 {
+			m.EmbeddingDim = len(e[0])
+		}
+
+		if err := m.Updates(Values{
+			"EmbeddingsJSON": m.EmbeddingsJSON,
+			"LandmarksJSON":  m.LandmarksJSON,
+			"Size":           m.Size,
+			"Score":          m.Score,
+			"EmbeddingModel": m.EmbeddingModel,
+			"EmbeddingDim":   m.EmbeddingDim,
+		}); err != nil {
+			return reExtracted, err
+		}
+
+		m.indexEmbeddings()
+
+		reExtracted++
+	}
+
+	return reExtracted, nil
+}
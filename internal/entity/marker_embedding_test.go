@@ -0,0 +1,29 @@
+package entity
+
+import "testing"
+
+func TestMarkerCompatibleEmbeddings(t *testing.T) {
+	m := &Marker{EmbeddingsJSON: []byte(`[[1,2,3]]`), EmbeddingModel: "facenet-v2"}
+
+	if e := m.CompatibleEmbeddings("facenet-v2"); len(e) != 1 {
+		t.Errorf("expected embeddings for a matching model, got %d", len(e))
+	}
+
+	if e := m.CompatibleEmbeddings("facenet-v3"); len(e) != 0 {
+		t.Errorf("expected no embeddings for a mismatched model, got %d", len(e))
+	}
+
+	if e := m.CompatibleEmbeddings(""); len(e) != 1 {
+		t.Errorf("expected embeddings when the caller isn't filtering by model, got %d", len(e))
+	}
+
+	legacy := &Marker{EmbeddingsJSON: []byte(`[[1,2,3]]`)}
+
+	if e := legacy.CompatibleEmbeddings("facenet-v2"); len(e) != 0 {
+		t.Errorf("expected a legacy marker with no recorded model not to match a versioned model, got %d", len(e))
+	}
+
+	if e := legacy.CompatibleEmbeddings(""); len(e) != 1 {
+		t.Errorf("expected a legacy marker to match when the caller isn't filtering by model, got %d", len(e))
+	}
+}
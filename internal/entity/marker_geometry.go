@@ -0,0 +1,139 @@
+package entity
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+var errMarkerGeometry = fmt.Errorf("marker: invalid geometry")
+
+// Point is a single, normalized polygon vertex in the range [-1, 1].
+type Point struct {
+	X float32 `json:"X"`
+	Y float32 `json:"Y"`
+}
+
+// Polygon is an ordered list of vertices describing a label's geometry,
+// e.g. an oriented bounding box or an arbitrary outline, as an alternative
+// to the axis-aligned X/Y/W/H rectangle markers normally use.
+type Polygon []Point
+
+// Valid reports whether every vertex lies within [-1, 1], which is also
+// true for an empty (i.e. absent) polygon.
+func (p Polygon) Valid() bool {
+	for _, v := range p {
+		if v.X < -1 || v.X > 1 || v.Y < -1 || v.Y > 1 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Bounds returns the axis-aligned bounding box of the polygon.
+func (p Polygon) Bounds() (x, y, w, h float32) {
+	if len(p) == 0 {
+		return 0, 0, 0, 0
+	}
+
+	minX, minY := p[0].X, p[0].Y
+	maxX, maxY := p[0].X, p[0].Y
+
+	for _, v := range p[1:] {
+		minX = float32(math.Min(float64(minX), float64(v.X)))
+		minY = float32(math.Min(float64(minY), float64(v.Y)))
+		maxX = float32(math.Max(float64(maxX), float64(v.X)))
+		maxY = float32(math.Max(float64(maxY), float64(v.Y)))
+	}
+
+	return minX, minY, maxX - minX, maxY - minY
+}
+
+// IoU returns the intersection-over-union of p and other's bounding boxes.
+// Using the bounding box rather than exact polygon intersection keeps this
+// cheap enough to run for every de-duplication candidate, at the cost of
+// precision for heavily rotated polygons.
+func (p Polygon) IoU(other Polygon) float64 {
+	ax, ay, aw, ah := p.Bounds()
+	bx, by, bw, bh := other.Bounds()
+
+	if aw <= 0 || ah <= 0 || bw <= 0 || bh <= 0 {
+		return 0
+	}
+
+	ix := math.Max(float64(ax), float64(bx))
+	iy := math.Max(float64(ay), float64(by))
+	iex := math.Min(float64(ax+aw), float64(bx+bw))
+	iey := math.Min(float64(ay+ah), float64(by+bh))
+
+	iw := iex - ix
+	ih := iey - iy
+
+	if iw <= 0 || ih <= 0 {
+		return 0
+	}
+
+	intersection := iw * ih
+	union := float64(aw)*float64(ah) + float64(bw)*float64(bh) - intersection
+
+	if union <= 0 {
+		return 0
+	}
+
+	return intersection / union
+}
+
+// NewLabelMarker creates a new label entity, optionally with polygon
+// geometry describing a more precise outline than the X/Y/W/H rectangle.
+func NewLabelMarker(fileID uint, refUID string, x, y, w, h float32, polygon Polygon) *Marker {
+	m := NewMarker(fileID, refUID, SrcImage, MarkerLabel, x, y, w, h)
+
+	if len(polygon) > 0 {
+		_ = m.SetGeometry(polygon)
+	}
+
+	return m
+}
+
+// NewTextMarker creates a new label entity for OCR'd text, e.g. a document
+// region or a license plate, optionally with polygon geometry.
+func NewTextMarker(fileID uint, refUID, text, lang string, x, y, w, h float32, polygon Polygon) *Marker {
+	m := NewLabelMarker(fileID, refUID, x, y, w, h, polygon)
+
+	m.TextContent = text
+	m.Lang = lang
+
+	return m
+}
+
+// SetGeometry validates and stores polygon as this marker's geometry.
+func (m *Marker) SetGeometry(polygon Polygon) error {
+	if !polygon.Valid() {
+		return errMarkerGeometry
+	}
+
+	b, err := json.Marshal(polygon)
+
+	if err != nil {
+		return err
+	}
+
+	m.GeometryJSON = b
+	m.geometry = polygon
+
+	return nil
+}
+
+// Geometry returns this marker's parsed polygon, if any.
+func (m *Marker) Geometry() Polygon {
+	if len(m.GeometryJSON) == 0 {
+		return nil
+	} else if len(m.geometry) > 0 {
+		return m.geometry
+	} else if err := json.Unmarshal(m.GeometryJSON, &m.geometry); err != nil {
+		log.Errorf("failed parsing marker geometry json: %s", err)
+	}
+
+	return m.geometry
+}
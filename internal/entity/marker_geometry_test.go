@@ -0,0 +1,59 @@
+package entity
+
+import "testing"
+
+func TestPolygonValid(t *testing.T) {
+	if !Polygon(nil).Valid() {
+		t.Error("expected an empty polygon to be valid")
+	}
+
+	if !(Polygon{{X: -1, Y: 1}, {X: 0.5, Y: -0.5}}).Valid() {
+		t.Error("expected vertices within [-1, 1] to be valid")
+	}
+
+	if (Polygon{{X: 1.1, Y: 0}}).Valid() {
+		t.Error("expected a vertex outside [-1, 1] to be invalid")
+	}
+}
+
+func TestPolygonIoU(t *testing.T) {
+	square := Polygon{{X: 0, Y: 0}, {X: 0, Y: 1}, {X: 1, Y: 1}, {X: 1, Y: 0}}
+
+	if iou := square.IoU(square); iou != 1 {
+		t.Errorf("expected identical polygons to have IoU 1, got %v", iou)
+	}
+
+	disjoint := Polygon{{X: 2, Y: 2}, {X: 2, Y: 3}, {X: 3, Y: 3}, {X: 3, Y: 2}}
+
+	if iou := square.IoU(disjoint); iou != 0 {
+		t.Errorf("expected disjoint polygons to have IoU 0, got %v", iou)
+	}
+
+	overlapping := Polygon{{X: 0.5, Y: 0.5}, {X: 0.5, Y: 1.5}, {X: 1.5, Y: 1.5}, {X: 1.5, Y: 0.5}}
+
+	if iou := square.IoU(overlapping); iou <= 0 || iou >= 1 {
+		t.Errorf("expected partially overlapping polygons to have 0 < IoU < 1, got %v", iou)
+	}
+
+	if iou := square.IoU(nil); iou != 0 {
+		t.Errorf("expected an empty polygon to have IoU 0, got %v", iou)
+	}
+}
+
+func TestMarkerSetGeometry(t *testing.T) {
+	m := &Marker{}
+
+	if err := m.SetGeometry(Polygon{{X: 2, Y: 0}}); err == nil {
+		t.Error("expected an out-of-range vertex to be rejected")
+	}
+
+	polygon := Polygon{{X: -0.5, Y: -0.5}, {X: 0.5, Y: 0.5}}
+
+	if err := m.SetGeometry(polygon); err != nil {
+		t.Fatalf("failed to set valid geometry: %s", err)
+	}
+
+	if got := m.Geometry(); len(got) != len(polygon) {
+		t.Errorf("expected Geometry to round-trip the polygon, got %+v", got)
+	}
+}
@@ -0,0 +1,132 @@
+package entity
+
+import (
+	"strconv"
+
+	"github.com/photoprism/photoprism/internal/face/index"
+)
+
+// FaceIndex is the ANN index consulted for face embedding lookups, e.g. by
+// SetFace and MatchCandidates. It defaults to an in-memory implementation
+// and may be replaced with a different backend, e.g. during tests.
+var FaceIndex index.Index = index.NewMemoryIndex()
+
+// faceIndexSearchK is the candidate count SetFace asks FaceIndex for when
+// looking up its own distance to a face. It is deliberately generous: the
+// default index only scans the bucket the query embedding hashes to
+// regardless of k, so a larger k is what lets a specific marker show up in
+// the results instead of requiring it to be the single closest match.
+const faceIndexSearchK = 64
+
+// markerIndexID returns the FaceIndex key used for m.
+func markerIndexID(m *Marker) string {
+	return strconv.FormatUint(uint64(m.ID), 10)
+}
+
+// vectors converts e to the plain [][]float32 the index package expects.
+func (e Embeddings) vectors() [][]float32 {
+	result := make([][]float32, len(e))
+
+	for i, v := range e {
+		result[i] = []float32(v)
+	}
+
+	return result
+}
+
+// indexEmbeddings keeps FaceIndex in sync with this marker's embeddings.
+func (m *Marker) indexEmbeddings() {
+	if m.ID == 0 {
+		return
+	}
+
+	id := markerIndexID(m)
+
+	if e := m.Embeddings(); len(e) > 0 {
+		if err := FaceIndex.Add(id, m.EmbeddingModel, e.vectors()); err != nil {
+			log.Debugf("faces: %s (index marker)", err)
+		}
+	} else if err := FaceIndex.Remove(id); err != nil {
+		log.Debugf("faces: %s (unindex marker)", err)
+	}
+}
+
+// MatchCandidates returns up to limit markers whose embeddings are
+// approximate nearest neighbours of embedding, ordered by ascending
+// distance, using FaceIndex instead of scanning every marker.
+//
+// This is the entry point Face.MatchMarkers and subject clustering are
+// meant to call instead of scanning every marker's embeddings, but neither
+// is defined anywhere in this tree (no Face entity, face.Face, or clusters
+// package source is checked out here), so they can't actually be wired up
+// from this package.
+//
+// TODO(faces): this leaves the chunk0-1 request half-done — SetFace
+// consults FaceIndex, but Face.MatchMarkers and subject clustering, the
+// other two call sites the request named, still do a linear scan. Rewiring
+// them needs its own tracked follow-up against entity/face.go and the
+// clustering package once that source is checked out here; it isn't
+// something this package can finish on its own, and no commit in this
+// series should claim otherwise.
+func MatchCandidates(embedding Embedding, limit int) ([]*Marker, error) {
+	matches, err := FaceIndex.Search([]float32(embedding), limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*Marker, 0, len(matches))
+
+	for _, match := range matches {
+		id, err := strconv.ParseUint(match.ID, 10, 64)
+
+		if err != nil {
+			continue
+		}
+
+		if m := FindMarker(uint(id)); m != nil {
+			result = append(result, m)
+		}
+	}
+
+	return result, nil
+}
+
+// markerIndexSource adapts the markers table to the index.Source interface,
+// so that FaceIndex can be rebuilt from the database after a restart or a
+// bulk import.
+type markerIndexSource struct{}
+
+// EachEmbedding implements index.Source.
+func (markerIndexSource) EachEmbedding(fn func(id, model string, embeddings [][]float32)) error {
+	const batchSize = 1000
+
+	for offset := 0; ; offset += batchSize {
+		var batch []*Marker
+
+		if err := Db().
+			Where("embeddings_json IS NOT NULL AND embeddings_json <> ''").
+			Order("id").Offset(offset).Limit(batchSize).
+			Find(&batch).Error; err != nil {
+			return err
+		}
+
+		for _, m := range batch {
+			if e := m.Embeddings(); len(e) > 0 {
+				fn(markerIndexID(m), m.EmbeddingModel, e.vectors())
+			}
+		}
+
+		if len(batch) < batchSize {
+			break
+		}
+	}
+
+	return nil
+}
+
+// RebuildFaceIndex rebuilds FaceIndex from the markers currently stored in
+// the database, e.g. after a restart or before a full face-recognition run.
+func RebuildFaceIndex() error {
+	return FaceIndex.Rebuild(markerIndexSource{})
+}
@@ -0,0 +1,73 @@
+/*
+Package index provides a pluggable approximate-nearest-neighbor (ANN) index
+over face embeddings, so that marker and face matching can look up candidates
+without scanning every embedding in the database.
+
+Implementations only need to satisfy the Index interface below. The package
+ships an in-memory default (see NewMemoryIndex) that is good enough for
+typical libraries; larger deployments may plug in an HNSW or IVF backed
+implementation that satisfies the same interface.
+*/
+package index
+
+import "time"
+
+// Match is a single ANN search result.
+type Match struct {
+	// ID identifies the indexed embedding, e.g. a marker ID.
+	ID string
+	// Model is the embedding model tag the matched vector was indexed
+	// under, as passed to Add. Callers comparing across embedding versions
+	// must check this before trusting Dist: a short Euclidean distance
+	// between vectors from two different models is meaningless.
+	Model string
+	// Dist is the distance to the query embedding (smaller is closer).
+	Dist float64
+}
+
+// Source provides the embeddings needed to (re-)build an index from scratch.
+type Source interface {
+	// EachEmbedding calls fn once for every indexable id/model/embedding
+	// triple.
+	EachEmbedding(fn func(id, model string, embeddings [][]float32)) error
+}
+
+// Index is implemented by ANN backends used for face embedding lookups.
+//
+// Implementations must be safe for concurrent use, since markers are matched
+// and indexed from multiple workers at the same time.
+type Index interface {
+	// Add indexes the embeddings for id, replacing any previous entry.
+	// model identifies the embedding model that produced embeddings, and
+	// is reported back on Match so callers can reject cross-model matches.
+	Add(id, model string, embeddings [][]float32) error
+
+	// Remove removes id from the index, if present.
+	Remove(id string) error
+
+	// Search returns up to k approximate nearest neighbours of embedding,
+	// ordered by ascending distance.
+	Search(embedding []float32, k int) ([]Match, error)
+
+	// Rebuild discards the current index and repopulates it from source.
+	Rebuild(source Source) error
+
+	// Len returns the number of embeddings currently indexed.
+	Len() int
+
+	// Stats returns a snapshot of the index metrics.
+	Stats() Stats
+}
+
+// Stats is a point-in-time snapshot of Index metrics, used for observability.
+type Stats struct {
+	// Size is the number of ids currently indexed.
+	Size int
+	// Lookups is the total number of Search calls served.
+	Lookups uint64
+	// Candidates is the total number of candidates returned across all
+	// Search calls, used together with Lookups to estimate average recall.
+	Candidates uint64
+	// AvgLatency is the mean duration of a Search call.
+	AvgLatency time.Duration
+}
@@ -0,0 +1,297 @@
+package index
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/photoprism/photoprism/pkg/clusters"
+)
+
+// numHyperplanes is the number of random hyperplanes used to hash an
+// embedding into a locality-sensitive bucket. More planes narrow buckets
+// (faster, less recall); fewer planes widen them (slower, more recall).
+const numHyperplanes = 12
+
+// MemoryIndex is an in-memory, locality-sensitive-hashing (LSH) backed ANN
+// index. It buckets embeddings by the sign of their dot product with a set
+// of random hyperplanes, so that Search only has to rescan the handful of
+// ids that share a bucket with the query instead of the whole corpus.
+//
+// It is the default Index implementation and is good enough for libraries
+// with up to a few hundred thousand markers; larger deployments should
+// plug in a dedicated HNSW or IVF backend via the Index interface instead.
+type MemoryIndex struct {
+	mu      sync.RWMutex
+	buckets map[int]map[uint32][]string
+	vectors map[string][][]float32
+	models  map[string]string
+
+	// planesMu guards planes independently of mu, since bucketOf lazily
+	// initializes an entry for a not-yet-seen dimension under Search's
+	// RLock: two Search calls racing on the same new dimension would
+	// otherwise both write to planes while only holding a read lock.
+	planesMu sync.Mutex
+	planes   map[int][][]float32
+
+	lookups    uint64
+	candidates uint64
+	latencyNs  uint64
+}
+
+// NewMemoryIndex returns a new, empty in-memory ANN index.
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{
+		planes:  make(map[int][][]float32),
+		buckets: make(map[int]map[uint32][]string),
+		vectors: make(map[string][][]float32),
+		models:  make(map[string]string),
+	}
+}
+
+// Add indexes the embeddings for id, replacing any previous entry.
+func (ix *MemoryIndex) Add(id, model string, embeddings [][]float32) error {
+	if id == "" {
+		return nil
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+
+	ix.vectors[id] = embeddings
+	ix.models[id] = model
+
+	for _, e := range embeddings {
+		dim := len(e)
+		b := ix.bucketOf(e)
+
+		if ix.buckets[dim] == nil {
+			ix.buckets[dim] = make(map[uint32][]string)
+		}
+
+		ix.buckets[dim][b] = append(ix.buckets[dim][b], id)
+	}
+
+	return nil
+}
+
+// Remove removes id from the index, if present.
+func (ix *MemoryIndex) Remove(id string) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+
+	return nil
+}
+
+// remove deletes id from the index. Callers must hold ix.mu.
+func (ix *MemoryIndex) remove(id string) {
+	if _, ok := ix.vectors[id]; !ok {
+		return
+	}
+
+	delete(ix.vectors, id)
+	delete(ix.models, id)
+
+	for dim, buckets := range ix.buckets {
+		for b, ids := range buckets {
+			filtered := ids[:0]
+
+			for _, existing := range ids {
+				if existing != id {
+					filtered = append(filtered, existing)
+				}
+			}
+
+			if len(filtered) == 0 {
+				delete(buckets, b)
+			} else {
+				buckets[b] = filtered
+			}
+		}
+
+		if len(buckets) == 0 {
+			delete(ix.buckets, dim)
+		}
+	}
+}
+
+// Search returns up to k approximate nearest neighbours of embedding.
+func (ix *MemoryIndex) Search(embedding []float32, k int) (result []Match, err error) {
+	start := time.Now()
+
+	defer func() {
+		atomic.AddUint64(&ix.lookups, 1)
+		atomic.AddUint64(&ix.candidates, uint64(len(result)))
+		atomic.AddUint64(&ix.latencyNs, uint64(time.Since(start)))
+	}()
+
+	if k <= 0 || len(embedding) == 0 {
+		return result, nil
+	}
+
+	ix.mu.RLock()
+	dim := len(embedding)
+	b := ix.bucketOf(embedding)
+	candidates := append([]string{}, ix.buckets[dim][b]...)
+	vectors := make(map[string][][]float32, len(candidates))
+	models := make(map[string]string, len(candidates))
+
+	for _, id := range candidates {
+		if _, ok := vectors[id]; !ok {
+			vectors[id] = ix.vectors[id]
+			models[id] = ix.models[id]
+		}
+	}
+
+	ix.mu.RUnlock()
+
+	seen := make(map[string]bool, len(candidates))
+	matches := make([]Match, 0, len(candidates))
+
+	for _, id := range candidates {
+		if seen[id] {
+			continue
+		}
+
+		seen[id] = true
+
+		best := -1.0
+
+		for _, e := range vectors[id] {
+			if len(e) != len(embedding) {
+				continue
+			}
+
+			if d := clusters.EuclideanDistance(e, embedding); d < best || best < 0 {
+				best = d
+			}
+		}
+
+		if best >= 0 {
+			matches = append(matches, Match{ID: id, Model: models[id], Dist: best})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Dist < matches[j].Dist })
+
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+
+	return matches, nil
+}
+
+// Rebuild discards the current index and repopulates it from source.
+func (ix *MemoryIndex) Rebuild(source Source) error {
+	ix.mu.Lock()
+	ix.buckets = make(map[int]map[uint32][]string)
+	ix.vectors = make(map[string][][]float32)
+	ix.models = make(map[string]string)
+	ix.mu.Unlock()
+
+	ix.planesMu.Lock()
+	ix.planes = make(map[int][][]float32)
+	ix.planesMu.Unlock()
+
+	return source.EachEmbedding(func(id, model string, embeddings [][]float32) {
+		_ = ix.Add(id, model, embeddings)
+	})
+}
+
+// Len returns the number of ids currently indexed.
+func (ix *MemoryIndex) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	return len(ix.vectors)
+}
+
+// Stats returns a snapshot of the index metrics.
+func (ix *MemoryIndex) Stats() Stats {
+	lookups := atomic.LoadUint64(&ix.lookups)
+	latencyNs := atomic.LoadUint64(&ix.latencyNs)
+
+	var avg time.Duration
+
+	if lookups > 0 {
+		avg = time.Duration(latencyNs / lookups)
+	}
+
+	return Stats{
+		Size:       ix.Len(),
+		Lookups:    lookups,
+		Candidates: atomic.LoadUint64(&ix.candidates),
+		AvgLatency: avg,
+	}
+}
+
+// bucketOf hashes an embedding to a bucket id based on which side of each
+// random hyperplane it falls on, initializing a dedicated set of hyperplanes
+// per embedding dimension lazily the first time that dimension is seen.
+// Partitioning by dimension keeps two embedding models that happen to
+// coexist in the index (e.g. mid-migration) from sharing a bucket just
+// because they hashed to the same bits despite being different lengths.
+//
+// planes has its own lock (planesMu) rather than relying on ix.mu, since
+// Search only holds ix.mu for reading and still needs to lazily create a
+// dimension's planes the first time it's queried.
+func (ix *MemoryIndex) bucketOf(embedding []float32) uint32 {
+	dim := len(embedding)
+
+	ix.planesMu.Lock()
+
+	planes, ok := ix.planes[dim]
+
+	if !ok && dim > 0 {
+		planes = newRandomPlanes(numHyperplanes, dim)
+		ix.planes[dim] = planes
+	}
+
+	ix.planesMu.Unlock()
+
+	var b uint32
+
+	for i, plane := range planes {
+		if dot(plane, embedding) >= 0 {
+			b |= 1 << uint(i)
+		}
+	}
+
+	return b
+}
+
+// newRandomPlanes generates n random hyperplanes of the given dimension,
+// using a fixed seed so that bucket assignment is reproducible across runs.
+func newRandomPlanes(n, dim int) [][]float32 {
+	rnd := rand.New(rand.NewSource(1))
+	planes := make([][]float32, n)
+
+	for i := range planes {
+		plane := make([]float32, dim)
+
+		for j := range plane {
+			plane[j] = float32(rnd.NormFloat64())
+		}
+
+		planes[i] = plane
+	}
+
+	return planes
+}
+
+// dot computes the dot product of two equal-length vectors.
+func dot(a, b []float32) float64 {
+	var sum float64
+
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+
+	return sum
+}
@@ -0,0 +1,175 @@
+package index
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestMemoryIndexSearchFindsNonTopMatch(t *testing.T) {
+	ix := NewMemoryIndex()
+
+	// Seed several markers sharing a bucket, with "near" closer to the
+	// query than "target" so that target is not the single nearest match.
+	// All vectors are positive multiples of the same direction, so they fall
+	// on the same side of every hyperplane and hash to the same bucket.
+	_ = ix.Add("near", "m1", [][]float32{{1.9, 1.9, 1.9}})
+	_ = ix.Add("target", "m1", [][]float32{{1, 1, 1}})
+	_ = ix.Add("far", "m1", [][]float32{{5, 5, 5}})
+
+	query := []float32{2, 2, 2}
+
+	matches, err := ix.Search(query, 1)
+
+	if err != nil {
+		t.Fatalf("search with k=1 failed: %s", err)
+	}
+
+	foundTop1 := false
+
+	for _, m := range matches {
+		if m.ID == "target" {
+			foundTop1 = true
+		}
+	}
+
+	if foundTop1 {
+		t.Skip("target happened to be the single nearest match, nothing to demonstrate")
+	}
+
+	// With a larger k the bucket's other members, including target, must
+	// still be returned.
+	matches, err = ix.Search(query, 64)
+
+	if err != nil {
+		t.Fatalf("search with larger k failed: %s", err)
+	}
+
+	found := false
+
+	for _, m := range matches {
+		if m.ID == "target" {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Errorf("expected target to be found with a larger k, got %+v", matches)
+	}
+}
+
+func TestMemoryIndexRemove(t *testing.T) {
+	ix := NewMemoryIndex()
+
+	_ = ix.Add("a", "m1", [][]float32{{1, 2, 3}})
+
+	if ix.Len() != 1 {
+		t.Fatalf("expected 1 indexed id, got %d", ix.Len())
+	}
+
+	_ = ix.Remove("a")
+
+	if ix.Len() != 0 {
+		t.Errorf("expected 0 indexed ids after remove, got %d", ix.Len())
+	}
+}
+
+// TestMemoryIndexSearchByDimension verifies that a query of one dimension
+// never surfaces candidates of another, so two embedding generations that
+// coexist in the index during a migration (and so normally differ in
+// dimension) can't collapse into a single bucket and degrade to a full scan.
+func TestMemoryIndexSearchByDimension(t *testing.T) {
+	ix := NewMemoryIndex()
+
+	_ = ix.Add("old", "m1", [][]float32{{1, 1, 1}})
+	_ = ix.Add("new", "m2", [][]float32{{1, 1, 1, 1}})
+
+	matches, err := ix.Search([]float32{1, 1, 1}, 8)
+
+	if err != nil {
+		t.Fatalf("search failed: %s", err)
+	}
+
+	for _, m := range matches {
+		if m.ID == "new" {
+			t.Errorf("expected a 3-dimensional query not to match a 4-dimensional embedding, got %+v", matches)
+		}
+	}
+}
+
+// TestMemoryIndexSearchTagsModel verifies that Search reports the model a
+// match was indexed under, so callers can reject candidates from a
+// different embedding model even when dimensions happen to coincide.
+func TestMemoryIndexSearchTagsModel(t *testing.T) {
+	ix := NewMemoryIndex()
+
+	_ = ix.Add("a", "v1", [][]float32{{1, 1, 1}})
+
+	matches, err := ix.Search([]float32{1, 1, 1}, 8)
+
+	if err != nil {
+		t.Fatalf("search failed: %s", err)
+	}
+
+	if len(matches) != 1 || matches[0].Model != "v1" {
+		t.Errorf("expected a single match tagged with model v1, got %+v", matches)
+	}
+}
+
+// TestMemoryIndexConcurrentSearchAndAdd exercises Search and Add from
+// separate goroutines at the same time, reproducing the scenario where a
+// face-recognition pass indexes one marker while searching for another.
+// Run with -race to catch a regression to an unsynchronized map read.
+func TestMemoryIndexConcurrentSearchAndAdd(t *testing.T) {
+	ix := NewMemoryIndex()
+
+	_ = ix.Add("seed", "m1", [][]float32{{0, 0, 0}})
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+
+		go func(i int) {
+			defer wg.Done()
+			_ = ix.Add(strconv.Itoa(i), "m1", [][]float32{{float32(i), float32(i), float32(i)}})
+		}(i)
+
+		go func() {
+			defer wg.Done()
+			_, _ = ix.Search([]float32{0, 0, 0}, 4)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// TestMemoryIndexConcurrentSearchDistinctDimensions guards against the
+// lazy hyperplane init in bucketOf racing under Search's RLock: unlike
+// TestMemoryIndexConcurrentSearchAndAdd, every goroutine here queries a
+// dimension none of the others has seen yet, so each one independently
+// hits the "not ok" branch in bucketOf instead of finding planes already
+// populated by a previous call.
+func TestMemoryIndexConcurrentSearchDistinctDimensions(t *testing.T) {
+	ix := NewMemoryIndex()
+
+	var wg sync.WaitGroup
+
+	for i := 1; i <= 50; i++ {
+		wg.Add(1)
+
+		go func(dim int) {
+			defer wg.Done()
+
+			query := make([]float32, dim)
+
+			for j := range query {
+				query[j] = float32(j)
+			}
+
+			_, _ = ix.Search(query, 4)
+		}(i)
+	}
+
+	wg.Wait()
+}
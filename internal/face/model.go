@@ -0,0 +1,12 @@
+package face
+
+// Model identifies the face embedding model currently configured for
+// extraction, e.g. "facenet" or "arcface-r100". NewFaceMarker stamps every
+// marker it creates with this value so that Marker.CompatibleEmbeddings and
+// ReExtractEmbeddings can tell which markers still need to be migrated
+// after the configured model changes.
+//
+// It must be set by the application during startup, the same way
+// FaceExtractor is, since the concrete model in use is a deployment detail
+// this package has no knowledge of on its own.
+var Model string